@@ -0,0 +1,178 @@
+package crawl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nutsdb/nutsdb"
+	"github.com/pkg/errors"
+)
+
+// ErrNotModified is returned by MarkdownWithOptions when the upstream page
+// hasn't changed since the last crawl, per a conditional GET. Callers (e.g.
+// the scheduler) can use it to skip re-embedding/re-summarizing the page and
+// reuse whatever Markdown they already have.
+var ErrNotModified = errors.New("crawl: page not modified since last fetch")
+
+// cacheBucket is the nutsdb bucket the HTTP cache is stored under.
+const cacheBucket = "crawl_http_cache"
+
+// cacheEntry is the persisted record for a cached URL.
+type cacheEntry struct {
+	ETag         string
+	LastModified string
+	BodyHash     string
+	Markdown     string
+	ExpiresAt    time.Time
+}
+
+// Cache is a persistent conditional-GET cache backed by nutsdb. It records
+// ETag/Last-Modified/body hash/expiry per URL so repeated crawls can send
+// If-None-Match/If-Modified-Since and skip re-downloading unchanged pages.
+type Cache struct {
+	db *nutsdb.DB
+}
+
+// NewCache wraps an already-open nutsdb database as an HTTP cache.
+func NewCache(db *nutsdb.DB) *Cache {
+	return &Cache{db: db}
+}
+
+// cache is the package-level cache used by Markdown/MarkdownWithOptions. A
+// nil cache (the default) disables conditional GETs entirely.
+var cache *Cache
+
+// SetCache installs the cache used by Markdown/MarkdownWithOptions for all
+// subsequent calls. Pass nil to disable caching.
+func SetCache(c *Cache) {
+	cache = c
+}
+
+func (c *Cache) get(u string) (cacheEntry, bool) {
+	var entry cacheEntry
+	err := c.db.View(func(tx *nutsdb.Tx) error {
+		item, err := tx.Get(cacheBucket, []byte(u))
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(item, &entry)
+	})
+	if err != nil {
+		return cacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+func (c *Cache) put(u string, entry cacheEntry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "marshal cache entry")
+	}
+
+	return c.db.Update(func(tx *nutsdb.Tx) error {
+		return tx.Put(cacheBucket, []byte(u), raw, nutsdb.Persistent)
+	})
+}
+
+// applyConditionalHeaders adds If-None-Match/If-Modified-Since to req when
+// we have a cached entry for its URL.
+func applyConditionalHeaders(req *http.Request) {
+	if cache == nil {
+		return
+	}
+	entry, ok := cache.get(req.URL.String())
+	if !ok {
+		return
+	}
+	if entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+}
+
+// handleCachedResponse interprets resp against the cache, returning the
+// cached Markdown (plus ErrNotModified) on a 304 or on a 200 whose body hash
+// matches the previous entry, honoring Retry-After on 429/503, and
+// otherwise storing a fresh entry from bodyBytes/md.
+func handleCachedResponse(u string, resp *http.Response, bodyBytes []byte, md string) (string, error) {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		return "", errors.Errorf("received status %d from %s%s", resp.StatusCode, u, retryAfterSuffix(resp))
+	}
+
+	if cache == nil {
+		return md, nil
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		entry, ok := cache.get(u)
+		if !ok {
+			return "", errors.Errorf("received 304 for %s with no cached entry", u)
+		}
+		return entry.Markdown, ErrNotModified
+	}
+
+	// Some servers return a plain 200 with no ETag/Last-Modified even when
+	// the body hasn't changed. Catch that case by comparing body hashes
+	// against the previous entry before reporting the page as changed.
+	bodyHash := hashBody(bodyBytes)
+	prev, hadPrev := cache.get(u)
+	unchanged := hadPrev && prev.BodyHash != "" && prev.BodyHash == bodyHash
+	if unchanged {
+		md = prev.Markdown
+	}
+
+	entry := cacheEntry{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		BodyHash:     bodyHash,
+		Markdown:     md,
+		ExpiresAt:    expiryFromHeaders(resp),
+	}
+	if err := cache.put(u, entry); err != nil {
+		return "", errors.Wrapf(err, "store cache entry for %s", u)
+	}
+
+	if unchanged {
+		return md, ErrNotModified
+	}
+
+	return md, nil
+}
+
+// hashBody hex-encodes a SHA-256 digest of b so it round-trips cleanly
+// through json.Marshal (a raw byte string corrupts on any non-UTF8
+// sequence) and stays comparable across crawls to detect an unchanged body.
+func hashBody(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// expiryFromHeaders honors Cache-Control: max-age, defaulting to no expiry
+// (i.e. always revalidate via conditional GET).
+func expiryFromHeaders(resp *http.Response) time.Time {
+	for _, directive := range strings.Split(resp.Header.Get("Cache-Control"), ",") {
+		if after, ok := strings.CutPrefix(strings.TrimSpace(directive), "max-age="); ok {
+			if secs, err := strconv.Atoi(after); err == nil {
+				return time.Now().Add(time.Duration(secs) * time.Second)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// retryAfterSuffix formats a Retry-After header for an error message, if
+// present.
+func retryAfterSuffix(resp *http.Response) string {
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		return " (retry after " + ra + ")"
+	}
+	return ""
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/temoto/robotstxt"
@@ -16,36 +17,139 @@ import (
 
 var httpClient = &http.Client{}
 
+// Render selects which Renderer fetches a page's HTML.
+type Render string
+
+const (
+	// RenderStatic does a plain HTTP GET (today's behavior).
+	RenderStatic Render = ""
+	// RenderBrowser always uses the configured Renderer (see SetRenderer)
+	// to render the page in a real browser before extraction.
+	RenderBrowser Render = "browser"
+	// RenderAuto does a static fetch first and only falls back to the
+	// configured Renderer when that yields under minRenderedTextLen bytes
+	// of extractable text, e.g. an SPA shell with no server-rendered HTML.
+	RenderAuto Render = "auto"
+)
+
+// MarkdownOptions controls how a fetched page is converted to Markdown.
+type MarkdownOptions struct {
+	// Readability strips boilerplate (nav, footers, ads, comment sections)
+	// before conversion by picking the highest-scoring content subtree.
+	// Pages where no clear main content is found fall back to full-page
+	// conversion.
+	Readability bool
+	// Render selects the static/browser fetch strategy. Defaults to
+	// RenderStatic.
+	Render Render
+}
+
 func Markdown(ctx context.Context, u string) (string, error) {
+	return MarkdownWithOptions(ctx, u, MarkdownOptions{})
+}
+
+// MarkdownWithOptions is like Markdown but lets the caller opt into
+// readability-style main-content extraction and headless-browser
+// rendering. If a cache is installed via SetCache and the page is still
+// fresh (Cache-Control: max-age) or unchanged (a 304 from a conditional
+// GET), it returns the cached Markdown and ErrNotModified so the caller
+// can skip re-embedding/re-summarizing it. Browser-rendered pages are not
+// cached, since their content isn't tied to ETag/Last-Modified headers.
+func MarkdownWithOptions(ctx context.Context, u string, opts MarkdownOptions) (string, error) {
+	if opts.Render == RenderBrowser {
+		rendered, err := guardedRender(ctx, u, renderer)
+		if err != nil {
+			return "", err
+		}
+		return htmlToMarkdown(rendered, opts)
+	}
+
+	if cache != nil {
+		if entry, ok := cache.get(u); ok && !entry.ExpiresAt.IsZero() && time.Now().Before(entry.ExpiresAt) {
+			return entry.Markdown, ErrNotModified
+		}
+	}
+
+	bodyBytes, resp, err := fetchHTML(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified || resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusServiceUnavailable {
+		return handleCachedResponse(u, resp, nil, "")
+	}
+
+	if opts.Render == RenderAuto && extractableTextLen(bodyBytes) < minRenderedTextLen {
+		if rendered, err := guardedRender(ctx, u, renderer); err == nil {
+			if md, err := htmlToMarkdown(rendered, opts); err == nil {
+				return md, nil
+			}
+		}
+		// Fall through to the (thin) static result if rendering failed.
+	}
+
+	md, err := htmlToMarkdown(bodyBytes, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return handleCachedResponse(u, resp, bodyBytes, md)
+}
+
+// fetchHTML checks robots.txt and GETs the page, sending conditional
+// headers (If-None-Match/If-Modified-Since) when a cache is installed and
+// has a prior entry for u. The caller is responsible for closing resp.Body.
+// On a 200 the body has already been read into the returned bytes; on
+// 304/429/503 the returned bytes are nil and the body is left unread.
+func fetchHTML(ctx context.Context, u string) ([]byte, *http.Response, error) {
 	// Check if the page is allowed.
 	if err := checkAllowed(ctx, u); err != nil {
-		return "", errors.Wrapf(err, "check robots.txt for %s", u)
+		return nil, nil, errors.Wrapf(err, "check robots.txt for %s", u)
 	}
 
 	// Prepare the request.
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
-		return "", errors.Wrapf(err, "create request for %s", u)
+		return nil, nil, errors.Wrapf(err, "create request for %s", u)
 	}
 	req.Header.Set("User-Agent", userAgent)
+	applyConditionalHeaders(req)
 
 	// Send the request.
-	resp, err := httpClient.Do(req)
+	resp, err := do(ctx, req)
 	if err != nil {
-		return "", errors.Wrapf(err, "fetch %s", u)
+		return nil, nil, errors.Wrapf(err, "fetch %s", u)
 	}
-	defer resp.Body.Close()
 
 	// Parse the response.
-	if resp.StatusCode != http.StatusOK {
-		return "", errors.Errorf("received non-200 status code %d from %s", resp.StatusCode, u)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return nil, resp, nil
+	default:
+		resp.Body.Close()
+		return nil, nil, errors.Errorf("received non-200 status code %d from %s", resp.StatusCode, u)
 	}
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", errors.Wrapf(err, "read body from %s", u)
+		resp.Body.Close()
+		return nil, nil, errors.Wrapf(err, "read body from %s", u)
+	}
+
+	return bodyBytes, resp, nil
+}
+
+// htmlToMarkdown converts a page body to Markdown, optionally extracting the
+// main content first.
+func htmlToMarkdown(bodyBytes []byte, opts MarkdownOptions) (string, error) {
+	if opts.Readability {
+		if main, ok := extractMainContent(bodyBytes); ok {
+			bodyBytes = main
+		}
 	}
 
-	// Convert the body to markdown.
 	mdBytes, err := textconvert.HTMLToMarkdown(bodyBytes)
 	if err != nil {
 		return "", errors.Wrap(err, "convert html to markdown")
@@ -67,6 +171,7 @@ func checkAllowed(ctx context.Context, u string) error {
 		return errors.Wrapf(err, "check robots.txt for %s", parsedURL.Host)
 	}
 	if !d.TestAgent(parsedURL.Path, userAgent) {
+		crawlRobotsDeniedTotal.WithLabelValues(parsedURL.Host).Inc()
 		return errors.Errorf("disallowed by robots.txt for %s", u)
 	}
 
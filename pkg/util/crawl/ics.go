@@ -0,0 +1,298 @@
+package crawl
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/pkg/errors"
+	"github.com/teambition/rrule-go"
+)
+
+// Event is a single calendar occurrence, normalized into the shape zenfeed's
+// rewriter/scheduler already expect for feed items (title/body/time).
+type Event struct {
+	UID          string
+	RecurrenceID string
+	Summary      string
+	Description  string
+	Location     string
+	Start        time.Time
+	End          time.Time
+}
+
+// defaultICSWindow bounds how far into the future recurring events are
+// expanded when the caller doesn't specify a window.
+const defaultICSWindow = 90 * 24 * time.Hour
+
+// ICS fetches an .ics URL and returns its VEVENT/VTODO components as
+// concrete occurrences, expanding any RRULE within [now, now+window).
+// Recurring events are deduplicated by UID+RECURRENCE-ID so repeated
+// crawls of the same feed don't yield duplicate occurrences. A window of
+// zero uses defaultICSWindow.
+func ICS(ctx context.Context, u string, window time.Duration) ([]Event, error) {
+	if window <= 0 {
+		window = defaultICSWindow
+	}
+
+	// Fetch the ICS body, going through the same robots.txt check and
+	// per-host scheduler as Markdown.
+	bodyBytes, resp, err := fetchHTML(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("received non-200 status code %d from %s", resp.StatusCode, u)
+	}
+	cal, err := ics.ParseCalendar(bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse ics from %s", u)
+	}
+
+	bases := componentBases(cal)
+	now := time.Now()
+	until := now.Add(window)
+
+	// A recurring series can have overriding instances: a second component
+	// sharing the master's UID, carrying RECURRENCE-ID (the original slot
+	// it replaces) and its own, possibly rescheduled, DTSTART. Collect those
+	// first so the master's RRULE expansion can skip the slots they replace.
+	overrides := make(map[string]map[string]Event)
+	replaced := make(map[string]map[string]struct{})
+	var masters []ics.ComponentBase
+	for _, base := range bases {
+		uid := propValue(base, ics.ComponentPropertyUniqueId)
+		recIDProp := base.GetProperty(ics.ComponentProperty(ics.PropertyRecurrenceId))
+		if recIDProp == nil {
+			masters = append(masters, base)
+			continue
+		}
+
+		recID, err := formatDateTimeValue(recIDProp)
+		if err != nil {
+			continue
+		}
+		if replaced[uid] == nil {
+			replaced[uid] = make(map[string]struct{})
+		}
+		replaced[uid][recID] = struct{}{}
+		event, ok := eventFromComponent(base, uid, recID, now, until)
+		if !ok {
+			continue
+		}
+		if overrides[uid] == nil {
+			overrides[uid] = make(map[string]Event)
+		}
+		overrides[uid][recID] = event
+	}
+
+	seen := make(map[string]struct{})
+	var events []Event
+	for _, base := range masters {
+		uid := propValue(base, ics.ComponentPropertyUniqueId)
+		suppressed := replaced[uid]
+
+		occurrences, err := expandOccurrences(base, now, until)
+		if err != nil {
+			// Malformed RRULE/DTSTART on a single event shouldn't sink the
+			// whole feed; skip it and keep going.
+			continue
+		}
+		for _, occ := range occurrences {
+			if _, replaced := suppressed[occ.recurrenceID]; replaced {
+				continue
+			}
+			key := uid + "\x00" + occ.recurrenceID
+			if _, dup := seen[key]; dup {
+				continue
+			}
+			seen[key] = struct{}{}
+			events = append(events, Event{
+				UID:          uid,
+				RecurrenceID: occ.recurrenceID,
+				Summary:      propValue(base, ics.ComponentPropertySummary),
+				Description:  propValue(base, ics.ComponentPropertyDescription),
+				Location:     propValue(base, ics.ComponentPropertyLocation),
+				Start:        occ.start,
+				End:          occ.start.Add(occ.duration),
+			})
+		}
+	}
+	for uid, byRecID := range overrides {
+		for recID, event := range byRecID {
+			key := uid + "\x00" + recID
+			if _, dup := seen[key]; dup {
+				continue
+			}
+			seen[key] = struct{}{}
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+// componentBases returns the ComponentBase of every VEVENT/VTODO in cal.
+func componentBases(cal *ics.Calendar) []ics.ComponentBase {
+	var bases []ics.ComponentBase
+	for _, c := range cal.Components {
+		switch v := c.(type) {
+		case *ics.VEvent:
+			bases = append(bases, v.ComponentBase)
+		case *ics.VTodo:
+			bases = append(bases, v.ComponentBase)
+		}
+	}
+	return bases
+}
+
+// eventFromComponent builds the Event for a single, non-recurring component
+// (used for overriding instances, which don't themselves carry an RRULE),
+// reporting ok=false if it has no DTSTART/DUE or falls outside [from, to).
+func eventFromComponent(base ics.ComponentBase, uid, recurrenceID string, from, to time.Time) (Event, bool) {
+	start, err := anchorTime(base)
+	if err != nil {
+		return Event{}, false
+	}
+	if start.Before(from) || !start.Before(to) {
+		return Event{}, false
+	}
+	duration := time.Hour
+	if end, err := propTime(base, ics.ComponentPropertyDtEnd); err == nil {
+		duration = end.Sub(start)
+	}
+
+	return Event{
+		UID:          uid,
+		RecurrenceID: recurrenceID,
+		Summary:      propValue(base, ics.ComponentPropertySummary),
+		Description:  propValue(base, ics.ComponentPropertyDescription),
+		Location:     propValue(base, ics.ComponentPropertyLocation),
+		Start:        start,
+		End:          start.Add(duration),
+	}, true
+}
+
+type occurrence struct {
+	start        time.Time
+	duration     time.Duration
+	recurrenceID string
+}
+
+// expandOccurrences resolves DTSTART/DTEND (honoring TZID) and, when an
+// RRULE is present, expands it into concrete occurrences inside [from, to).
+// Non-recurring events yield a single occurrence if it falls in the window.
+// recurrenceID always identifies the occurrence's original (unmodified)
+// slot, so an overriding instance's RECURRENCE-ID can be matched against it.
+func expandOccurrences(base ics.ComponentBase, from, to time.Time) ([]occurrence, error) {
+	start, err := anchorTime(base)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse DTSTART/DUE")
+	}
+	duration := time.Hour
+	if end, err := propTime(base, ics.ComponentPropertyDtEnd); err == nil {
+		duration = end.Sub(start)
+	}
+
+	rruleValue := propValue(base, ics.ComponentPropertyRrule)
+	if rruleValue == "" {
+		if start.Before(from) || !start.Before(to) {
+			return nil, nil
+		}
+		return []occurrence{{start: start, duration: duration, recurrenceID: start.UTC().Format(time.RFC3339)}}, nil
+	}
+
+	opt, err := rrule.StrToROption(rruleValue)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse RRULE")
+	}
+	opt.Dtstart = start
+	rule, err := rrule.NewRRule(*opt)
+	if err != nil {
+		return nil, errors.Wrap(err, "build RRULE")
+	}
+
+	occurrences := make([]occurrence, 0)
+	for _, occStart := range rule.Between(from, to, true) {
+		if !occStart.Before(to) {
+			continue
+		}
+		occurrences = append(occurrences, occurrence{
+			start:        occStart,
+			duration:     duration,
+			recurrenceID: occStart.UTC().Format(time.RFC3339),
+		})
+	}
+
+	return occurrences, nil
+}
+
+// propValue returns a property's raw value, or "" if it's not present.
+func propValue(c ics.ComponentBase, property ics.ComponentProperty) string {
+	prop := c.GetProperty(property)
+	if prop == nil {
+		return ""
+	}
+	return prop.Value
+}
+
+// anchorTime returns the time a component occupies on the calendar: DTSTART
+// for VEVENTs, falling back to DUE for VTODOs that carry no DTSTART (a task
+// with only a deadline, which golang-ical represents the same way).
+func anchorTime(base ics.ComponentBase) (time.Time, error) {
+	if t, err := propTime(base, ics.ComponentPropertyDtStart); err == nil {
+		return t, nil
+	}
+	return propTime(base, ics.ComponentPropertyDue)
+}
+
+// propTime parses a DATE-TIME property, resolving its TZID parameter so
+// recurring events expand in the correct timezone. A value with no TZID, or
+// with a TZID that isn't a known IANA zone name, is read as UTC.
+func propTime(c ics.ComponentBase, property ics.ComponentProperty) (time.Time, error) {
+	prop := c.GetProperty(property)
+	if prop == nil {
+		return time.Time{}, errors.Errorf("missing property %s", property)
+	}
+	return parseDateTimeProp(prop)
+}
+
+// formatDateTimeValue parses prop the same way propTime does and formats it
+// as the canonical recurrenceID (UTC RFC3339), so a RECURRENCE-ID property
+// can be compared against an expanded occurrence's recurrenceID.
+func formatDateTimeValue(prop *ics.IANAProperty) (string, error) {
+	t, err := parseDateTimeProp(prop)
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+func parseDateTimeProp(prop *ics.IANAProperty) (time.Time, error) {
+	// A trailing "Z" always means UTC per RFC 5545, even if a (non-compliant)
+	// TZID parameter is also present.
+	if strings.HasSuffix(prop.Value, "Z") {
+		if t, err := time.ParseInLocation("20060102T150405Z", prop.Value, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+
+	loc := time.UTC
+	if tzids, ok := prop.ICalParameters["TZID"]; ok && len(tzids) > 0 {
+		if l, err := time.LoadLocation(tzids[0]); err == nil {
+			loc = l
+		}
+	}
+
+	for _, layout := range []string{"20060102T150405", "20060102"} {
+		if t, err := time.ParseInLocation(layout, prop.Value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.Errorf("unrecognized DATE-TIME value %q", prop.Value)
+}
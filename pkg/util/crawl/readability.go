@@ -0,0 +1,90 @@
+package crawl
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// boilerplateSelector matches elements that are essentially never part of a
+// page's main content and are dropped before scoring.
+const boilerplateSelector = `nav, header, footer, aside, [role="navigation"], [role="banner"], [role="complementary"], script, style, noscript, form`
+
+// boilerplateClassRe matches class/id hints commonly used for chrome that
+// isn't caught by boilerplateSelector (comment threads, share bars, promos).
+var boilerplateClassRe = regexp.MustCompile(`(?i)comment|sidebar|share|promo|advert|cookie|subscribe|related|popup|masthead|breadcrumb`)
+
+// candidateSelector lists the block elements eligible to be the main
+// content root.
+const candidateSelector = "article, main, section, div"
+
+// minCandidateTextLen is the shortest extracted text we still consider a
+// successful extraction; shorter and we fall back to the full page.
+const minCandidateTextLen = 200
+
+// extractMainContent runs a Readability-like scoring pass over html and
+// returns the markup of the highest-scoring subtree. It reports ok=false
+// when no candidate has at least minCandidateTextLen bytes of text with a
+// link density of at most 0.5, so the caller can fall back to converting
+// the full page.
+func extractMainContent(html []byte) (out []byte, ok bool) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	if err != nil {
+		return nil, false
+	}
+
+	doc.Find(boilerplateSelector).Remove()
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		class, _ := s.Attr("class")
+		id, _ := s.Attr("id")
+		if boilerplateClassRe.MatchString(class) || boilerplateClassRe.MatchString(id) {
+			s.Remove()
+		}
+	})
+
+	var best *goquery.Selection
+	bestScore := 0.0
+	doc.Find(candidateSelector).Each(func(_ int, s *goquery.Selection) {
+		score := scoreNode(s)
+		if score > bestScore {
+			bestScore = score
+			best = s
+		}
+	})
+
+	if best == nil || len(strings.TrimSpace(best.Text())) < minCandidateTextLen {
+		return nil, false
+	}
+
+	content, err := best.Html()
+	if err != nil {
+		return nil, false
+	}
+
+	return []byte(content), true
+}
+
+// scoreNode scores a subtree by text density, penalizing high link-density
+// content (nav-like lists of links) and very short blocks.
+func scoreNode(s *goquery.Selection) float64 {
+	text := strings.TrimSpace(s.Text())
+	textLen := len(text)
+	if textLen < minCandidateTextLen {
+		return 0
+	}
+
+	linkTextLen := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		linkTextLen += len(strings.TrimSpace(a.Text()))
+	})
+	linkDensity := float64(linkTextLen) / float64(textLen)
+	if linkDensity > 0.5 {
+		return 0
+	}
+
+	paragraphs := s.Find("p").Length()
+
+	return float64(textLen) * (1 - linkDensity) * (1 + 0.1*float64(paragraphs))
+}
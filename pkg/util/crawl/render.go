@@ -0,0 +1,124 @@
+package crawl
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/chromedp/chromedp"
+	"github.com/pkg/errors"
+)
+
+// Renderer fetches a page's rendered HTML. The default httpRenderer does a
+// plain GET; a ChromeDPRenderer can be installed via SetRenderer for
+// JavaScript-heavy pages that return near-empty HTML to a static fetch.
+type Renderer interface {
+	Render(ctx context.Context, u string) ([]byte, error)
+}
+
+// httpRenderer is today's behavior: a static HTTP GET with no JS execution.
+type httpRenderer struct{}
+
+func (httpRenderer) Render(ctx context.Context, u string) ([]byte, error) {
+	bodyBytes, resp, err := fetchHTML(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("received non-200 status code %d from %s", resp.StatusCode, u)
+	}
+
+	return bodyBytes, nil
+}
+
+// renderer is the Renderer used for RenderBrowser/RenderAuto requests.
+var renderer Renderer = httpRenderer{}
+
+// SetRenderer installs the Renderer used for RenderBrowser/RenderAuto
+// requests. Install a *ChromeDPRenderer pointed at a local Chromium or
+// remote browserless endpoint to enable headless rendering.
+func SetRenderer(r Renderer) {
+	renderer = r
+}
+
+// minRenderedTextLen is the extractable-text threshold below which
+// RenderAuto retries the page with the configured Renderer.
+const minRenderedTextLen = 200
+
+// extractableTextLen estimates how much real text a page has, using the
+// same main-content extraction as MarkdownOptions.Readability. extractMainContent
+// reports ok=false when no subtree has even minCandidateTextLen of text, so
+// that case means "thin page", not "fall back to the raw byte count".
+func extractableTextLen(bodyBytes []byte) int {
+	main, ok := extractMainContent(bodyBytes)
+	if !ok {
+		return 0
+	}
+	return len(main)
+}
+
+// guardedRender applies the same robots.txt check and per-host pacing the
+// static fetch path uses, then delegates to r. This keeps those protections
+// in front of whichever renderer runs.
+//
+// httpRenderer is exempted: it calls fetchHTML, which already does its own
+// checkAllowed + scheduler wait/release. Applying both here too would pace
+// every httpRenderer request twice and hold two of the host's concurrency
+// slots for the same in-flight request.
+func guardedRender(ctx context.Context, u string, r Renderer) ([]byte, error) {
+	if _, ok := r.(httpRenderer); ok {
+		return r.Render(ctx, u)
+	}
+
+	if err := checkAllowed(ctx, u); err != nil {
+		return nil, errors.Wrapf(err, "check robots.txt for %s", u)
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse url %s", u)
+	}
+
+	st := sharedScheduler.state(ctx, parsed.Host)
+	if err := st.wait(ctx, parsed.Host); err != nil {
+		return nil, err
+	}
+	defer st.release(parsed.Host)
+
+	return r.Render(ctx, u)
+}
+
+// ChromeDPRenderer renders a page in a real browser over the Chrome
+// DevTools Protocol, for SPAs and other JS-heavy pages a static GET can't
+// see past.
+type ChromeDPRenderer struct {
+	// Endpoint is the CDP address to dial, e.g. a local Chromium's
+	// --remote-debugging-port ("http://127.0.0.1:9222") or a remote
+	// browserless service's websocket URL.
+	Endpoint string
+	// WaitFor, if set, is a CSS selector ChromeDPRenderer waits to become
+	// visible before capturing the rendered HTML, for pages that hydrate
+	// asynchronously.
+	WaitFor string
+}
+
+func (r *ChromeDPRenderer) Render(ctx context.Context, u string) ([]byte, error) {
+	allocCtx, cancelAlloc := chromedp.NewRemoteAllocator(ctx, r.Endpoint)
+	defer cancelAlloc()
+	taskCtx, cancelTask := chromedp.NewContext(allocCtx)
+	defer cancelTask()
+
+	tasks := chromedp.Tasks{chromedp.Navigate(u)}
+	if r.WaitFor != "" {
+		tasks = append(tasks, chromedp.WaitVisible(r.WaitFor, chromedp.ByQuery))
+	}
+	var html string
+	tasks = append(tasks, chromedp.OuterHTML("html", &html, chromedp.ByQuery))
+
+	if err := chromedp.Run(taskCtx, tasks); err != nil {
+		return nil, errors.Wrapf(err, "render %s via chromedp", u)
+	}
+
+	return []byte(html), nil
+}
@@ -0,0 +1,248 @@
+package crawl
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// defaultHostDelay is the minimum gap between requests to the same host
+	// when robots.txt doesn't specify a Crawl-Delay.
+	defaultHostDelay = time.Second
+	// defaultHostConcurrency caps in-flight requests per host.
+	defaultHostConcurrency = 2
+	// maxRetries bounds retries of transient failures.
+	maxRetries = 3
+)
+
+var (
+	crawlQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zenfeed",
+		Subsystem: "crawl",
+		Name:      "queue_depth",
+		Help:      "Number of requests currently queued or in flight per host.",
+	}, []string{"host"})
+	crawlRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "zenfeed",
+		Subsystem: "crawl",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of crawl requests by host and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host", "status"})
+	crawlRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zenfeed",
+		Subsystem: "crawl",
+		Name:      "retries_total",
+		Help:      "Number of retried crawl requests by host.",
+	}, []string{"host"})
+	crawlRobotsDeniedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zenfeed",
+		Subsystem: "crawl",
+		Name:      "robots_denied_total",
+		Help:      "Number of requests disallowed by robots.txt by host.",
+	}, []string{"host"})
+)
+
+// hostState tracks the per-host rate limit and concurrency cap.
+type hostState struct {
+	sem    chan struct{}
+	mu     sync.Mutex
+	nextAt time.Time
+	delay  time.Duration
+}
+
+// scheduler queues and paces requests per host (host = eTLD+1), so a single
+// feed with many items from the same site doesn't hammer it.
+type scheduler struct {
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+var sharedScheduler = &scheduler{hosts: make(map[string]*hostState)}
+
+func (s *scheduler) state(ctx context.Context, host string) *hostState {
+	key := registeredDomain(host)
+
+	s.mu.Lock()
+	st, ok := s.hosts[key]
+	if !ok {
+		st = &hostState{
+			sem:   make(chan struct{}, defaultHostConcurrency),
+			delay: hostDelay(ctx, host),
+		}
+		s.hosts[key] = st
+	}
+	s.mu.Unlock()
+
+	return st
+}
+
+// ensureMinDelay raises host's pacing delay to at least min, creating its
+// scheduler state first if needed. This lets a caller-requested delay (e.g.
+// Site's SiteOptions.Delay) apply to the one shared per-host pace instead
+// of running its own, uncoordinated limiter.
+func (s *scheduler) ensureMinDelay(ctx context.Context, host string, min time.Duration) {
+	if min <= 0 {
+		return
+	}
+
+	st := s.state(ctx, host)
+	st.mu.Lock()
+	if min > st.delay {
+		st.delay = min
+	}
+	st.mu.Unlock()
+}
+
+// registeredDomain returns host's eTLD+1 (e.g. "blog.example.com" ->
+// "example.com"), falling back to host itself if it can't be determined.
+func registeredDomain(host string) string {
+	if d, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return d
+	}
+	return host
+}
+
+// hostDelay returns the larger of defaultHostDelay and the host's
+// robots.txt Crawl-Delay directive, if any.
+func hostDelay(ctx context.Context, host string) time.Duration {
+	delay := defaultHostDelay
+	data, err := getRobotsData(ctx, host)
+	if err != nil {
+		return delay
+	}
+	if group := data.FindGroup(userAgent); group != nil && group.CrawlDelay > delay {
+		delay = group.CrawlDelay
+	}
+	return delay
+}
+
+// wait blocks until it's this host's turn, honoring both the concurrency
+// cap and the minimum delay since the last request.
+func (st *hostState) wait(ctx context.Context, host string) error {
+	crawlQueueDepth.WithLabelValues(host).Inc()
+	select {
+	case st.sem <- struct{}{}:
+	case <-ctx.Done():
+		crawlQueueDepth.WithLabelValues(host).Dec()
+		return ctx.Err()
+	}
+
+	st.mu.Lock()
+	sleep := time.Until(st.nextAt)
+	if sleep < 0 {
+		sleep = 0
+	}
+	st.nextAt = time.Now().Add(sleep + st.delay)
+	st.mu.Unlock()
+
+	if sleep > 0 {
+		timer := time.NewTimer(sleep)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			<-st.sem
+			crawlQueueDepth.WithLabelValues(host).Dec()
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (st *hostState) release(host string) {
+	<-st.sem
+	crawlQueueDepth.WithLabelValues(host).Dec()
+}
+
+// do sends req through the shared scheduler: it queues/paces per host and
+// retries transient failures (network errors, 5xx, 429) with exponential
+// backoff and jitter, honoring Retry-After. It never retries on context
+// cancellation or a successful, non-retryable response.
+func do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	st := sharedScheduler.state(ctx, host)
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if waitErr := st.wait(ctx, host); waitErr != nil {
+			return nil, waitErr
+		}
+
+		start := time.Now()
+		resp, err = httpClient.Do(req)
+		st.release(host)
+
+		status := "error"
+		if resp != nil {
+			status = strconv.Itoa(resp.StatusCode)
+		}
+		crawlRequestDuration.WithLabelValues(host, status).Observe(time.Since(start).Seconds())
+
+		if !retryable(resp, err) || attempt == maxRetries {
+			break
+		}
+		crawlRetriesTotal.WithLabelValues(host).Inc()
+
+		backoff := retryDelay(resp, attempt)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetch %s", req.URL)
+	}
+
+	return resp, nil
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	if resp == nil {
+		return false
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// retryDelay honors a Retry-After header when present, in either of its two
+// RFC 7231 forms (a number of seconds or an HTTP-date), otherwise backs off
+// exponentially with jitter.
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if resp != nil {
+		if ra := resp.Header.Get("Retry-After"); ra != "" {
+			if secs, err := strconv.Atoi(ra); err == nil {
+				return time.Duration(secs) * time.Second
+			}
+			if when, err := http.ParseTime(ra); err == nil {
+				if d := time.Until(when); d > 0 {
+					return d
+				}
+			}
+		}
+	}
+
+	base := time.Duration(1<<attempt) * 500 * time.Millisecond
+	jitter := time.Duration(rand.Int63n(int64(base) / 2))
+	return base + jitter
+}
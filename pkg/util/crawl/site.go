@@ -0,0 +1,257 @@
+package crawl
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/glob"
+	"github.com/gocolly/colly/v2"
+	"github.com/pkg/errors"
+)
+
+// Page is a single page discovered while deep-crawling a site.
+type Page struct {
+	URL      string
+	Links    []string
+	Markdown string
+}
+
+// SiteOptions configures Site.
+type SiteOptions struct {
+	// MarkdownOptions applies to each page's conversion. Only Readability
+	// takes effect: Site always converts colly's static response and does
+	// not read Render.
+	MarkdownOptions
+
+	// MaxDepth limits how many link-hops from the seed URL are followed.
+	// 0 means unlimited.
+	MaxDepth int
+	// MaxPages caps the total number of pages visited. 0 means unlimited.
+	MaxPages int
+	// SameDomain loosens the default same-host scoping to the seed URL's
+	// registered domain, so e.g. a seed of "example.com" also matches
+	// "blog.example.com".
+	SameDomain bool
+	// Allow, if non-empty, only visits URLs matching at least one glob
+	// (github.com/gobwas/glob syntax with '/' as the separator, matched
+	// against the full URL, e.g. "**/blog/**").
+	Allow []string
+	// Deny skips URLs matching any glob, checked after Allow.
+	Deny []string
+	// Concurrency caps in-flight requests per host. Defaults to 2.
+	Concurrency int
+	// Delay is the minimum gap between requests to the same host. Defaults
+	// to 1s when unset, and is raised to the host's robots.txt Crawl-Delay
+	// if that's larger.
+	Delay time.Duration
+	// Sitemap, if true, seeds the crawl with URLs discovered from
+	// /sitemap.xml in addition to the seed URL's own links.
+	Sitemap bool
+}
+
+// Site walks a site starting at seed using the configured scoping rules,
+// returning every page visited along with its Markdown body and the links
+// discovered on it.
+func Site(ctx context.Context, seed string, opts SiteOptions) ([]Page, error) {
+	seedURL, err := url.Parse(seed)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse seed url %s", seed)
+	}
+
+	allow, err := compileGlobs(opts.Allow)
+	if err != nil {
+		return nil, errors.Wrap(err, "compile allow patterns")
+	}
+	deny, err := compileGlobs(opts.Deny)
+	if err != nil {
+		return nil, errors.Wrap(err, "compile deny patterns")
+	}
+
+	c := colly.NewCollector(
+		colly.UserAgent(userAgent),
+		colly.Async(true),
+	)
+	if opts.MaxDepth > 0 {
+		// colly counts the seed itself as depth 1.
+		c.MaxDepth = opts.MaxDepth + 1
+	}
+	// SameDomain scopes to the seed's registered domain (so subdomains like
+	// "blog.example.com" match a seed of "example.com"), checked in
+	// OnRequest since colly's AllowedDomains only matches exact hosts;
+	// otherwise (the default) we scope to the seed's exact host.
+	seedDomain := registeredDomain(seedURL.Hostname())
+	if !opts.SameDomain {
+		c.AllowedDomains = []string{seedURL.Hostname()}
+	}
+
+	// Route every request colly fires through the shared scheduler instead
+	// of colly's own limiter, so a deep crawl shares one throttle, one
+	// retry-with-backoff policy, and one set of Prometheus metrics with
+	// Markdown/ICS against the same host. Parallelism here just bounds how
+	// many goroutines colly keeps in flight waiting on the scheduler; the
+	// actual pacing happens inside do().
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 2
+	}
+	if err := c.Limit(&colly.LimitRule{DomainGlob: "*", Parallelism: concurrency}); err != nil {
+		return nil, errors.Wrap(err, "configure crawl limits")
+	}
+	sharedScheduler.ensureMinDelay(ctx, seedURL.Host, opts.Delay)
+	c.SetClient(&http.Client{Transport: schedulerTransport{}})
+
+	// pages is appended to from OnHTML, and admitted counts the requests
+	// OnRequest lets through toward MaxPages; both run concurrently across
+	// per-host goroutines since the collector is async, so both accesses go
+	// through pagesMu.
+	var pagesMu sync.Mutex
+	var pages []Page
+	admitted := 0
+	c.OnRequest(func(r *colly.Request) {
+		if opts.SameDomain && registeredDomain(r.URL.Hostname()) != seedDomain {
+			r.Abort()
+			return
+		}
+		if err := checkAllowed(ctx, r.URL.String()); err != nil {
+			r.Abort()
+			return
+		}
+		if len(allow) > 0 && !matchAny(allow, r.URL.String()) {
+			r.Abort()
+			return
+		}
+		if matchAny(deny, r.URL.String()) {
+			r.Abort()
+			return
+		}
+		pagesMu.Lock()
+		tooMany := opts.MaxPages > 0 && admitted >= opts.MaxPages
+		if !tooMany {
+			admitted++
+		}
+		pagesMu.Unlock()
+		if tooMany {
+			r.Abort()
+		}
+	})
+
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		var links []string
+		e.ForEach("a[href]", func(_ int, el *colly.HTMLElement) {
+			link := el.Request.AbsoluteURL(el.Attr("href"))
+			if link == "" {
+				return
+			}
+			links = append(links, link)
+			_ = e.Request.Visit(link)
+		})
+
+		md, err := htmlToMarkdown(e.Response.Body, opts.MarkdownOptions)
+		if err != nil {
+			return
+		}
+		pagesMu.Lock()
+		pages = append(pages, Page{
+			URL:      e.Request.URL.String(),
+			Links:    links,
+			Markdown: md,
+		})
+		pagesMu.Unlock()
+	})
+
+	seeds := []string{seed}
+	if opts.Sitemap {
+		sitemapURLs, err := discoverSitemap(ctx, seedURL)
+		if err == nil {
+			seeds = append(seeds, sitemapURLs...)
+		}
+	}
+	for _, s := range seeds {
+		var alreadyVisited *colly.AlreadyVisitedError
+		if err := c.Visit(s); err != nil && !errors.As(err, &alreadyVisited) {
+			return nil, errors.Wrapf(err, "visit %s", s)
+		}
+	}
+	c.Wait()
+
+	return pages, nil
+}
+
+// schedulerTransport routes colly's HTTP traffic through the shared
+// scheduler (see scheduler.go's do) instead of colly's own transport, so a
+// deep crawl is paced, retried, and measured the same way Markdown/ICS
+// fetches are.
+type schedulerTransport struct{}
+
+func (schedulerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return do(req.Context(), req)
+}
+
+func compileGlobs(patterns []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, 0, len(patterns))
+	for _, p := range patterns {
+		g, err := glob.Compile(p, '/')
+		if err != nil {
+			return nil, errors.Wrapf(err, "compile glob %q", p)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+func matchAny(globs []glob.Glob, s string) bool {
+	for _, g := range globs {
+		if g.Match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// sitemapURLSet mirrors the subset of the sitemap.xml schema we care about.
+type sitemapURLSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	URLs    []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+}
+
+// discoverSitemap fetches seed's /sitemap.xml and returns the URLs it lists,
+// to use as additional crawl seeds.
+func discoverSitemap(ctx context.Context, seed *url.URL) ([]string, error) {
+	sitemapURL := (&url.URL{Scheme: seed.Scheme, Host: seed.Host, Path: "/sitemap.xml"}).String()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create request for %s", sitemapURL)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := do(ctx, req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetch %s", sitemapURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("received non-200 status code %d from %s", resp.StatusCode, sitemapURL)
+	}
+
+	var set sitemapURLSet
+	if err := xml.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, errors.Wrapf(err, "parse sitemap from %s", sitemapURL)
+	}
+
+	urls := make([]string, 0, len(set.URLs))
+	for _, u := range set.URLs {
+		if loc := strings.TrimSpace(u.Loc); loc != "" {
+			urls = append(urls, loc)
+		}
+	}
+
+	return urls, nil
+}